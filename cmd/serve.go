@@ -1,21 +1,147 @@
 package cmd
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+
+	// logrus is used here for Fatal and leveled output at the CLI entry
+	// point; the cmd package has no prior baseline logger to stay
+	// consistent with, unlike core (which uses github.com/go-log/log).
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/wencaiwulue/kubevpn/core"
 	"github.com/wencaiwulue/kubevpn/pkg"
 	"github.com/wencaiwulue/kubevpn/util"
 )
 
 var nodeConfig pkg.Route
+var adminSocket string
+var configFile string
+var multicastAddr string
+var multicastIfaceAllow string
+var multicastIfaceDeny string
+var multicastTrustPeers []string
 
 func init() {
 	ServerCmd.Flags().StringArrayVarP(&nodeConfig.ServeNodes, "nodeCommand", "L", []string{}, "command needs to be executed")
 	ServerCmd.Flags().StringVarP(&nodeConfig.ChainNode, "chainCommand", "F", "", "command needs to be executed")
 	ServerCmd.Flags().BoolVar(&util.Debug, "debug", false, "true/false")
+	ServerCmd.Flags().StringVar(&adminSocket, "admin-socket", "", "unix socket path for the admin control API, disabled if empty")
+	ServerCmd.Flags().StringVar(&configFile, "config", "", "path to a YAML config file (serveNodes/chainNode); sending SIGHUP re-reads it and hot-reloads the running server")
+	ServerCmd.Flags().StringVar(&nodeConfig.Stack, "stack", "system", "IP stack backend: system (kernel TUN) or gvisor (userspace netstack, no /dev/net/tun required)")
+	ServerCmd.Flags().StringVar(&multicastAddr, "multicast-advertise", "", "this node's own address to advertise over LAN multicast peer discovery, disabled if empty")
+	ServerCmd.Flags().StringVar(&multicastIfaceAllow, "multicast-iface-allow", "", "regex of interface names multicast beaconing/listening is restricted to, unrestricted if empty")
+	ServerCmd.Flags().StringVar(&multicastIfaceDeny, "multicast-iface-deny", "", "regex of interface names excluded from multicast beaconing/listening, none excluded if empty")
+	ServerCmd.Flags().StringArrayVar(&multicastTrustPeers, "multicast-trust-peer", []string{}, "node ID of a multicast peer to confirm onto the chain automatically as soon as discovered, can be repeated; use this (instead of the confirmMulticastPeer admin handler) when running --multicast-advertise without --admin-socket")
 	RootCmd.AddCommand(ServerCmd)
 }
 
+// serveConfig is the on-disk shape of --config.
+type serveConfig struct {
+	ServeNodes []string `yaml:"serveNodes"`
+	ChainNode  string   `yaml:"chainNode"`
+}
+
+func loadConfigFile(path string) (core.Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return core.Config{}, err
+	}
+	var sc serveConfig
+	if err = yaml.Unmarshal(b, &sc); err != nil {
+		return core.Config{}, err
+	}
+	return core.Config{ServeNodes: sc.ServeNodes, ChainNode: sc.ChainNode}, nil
+}
+
+// watchConfigReload re-reads configFile on every SIGHUP and applies the
+// diff via reloader: newly-added ServeNodes are started with
+// pkg.AddServeNode, removed ones have their listener drained and closed
+// with pkg.RemoveServeNode. It blocks and is meant to be run in its own
+// goroutine.
+func watchConfigReload(reloader *core.Reloader) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	for range sigCh {
+		cfg, err := loadConfigFile(configFile)
+		if err != nil {
+			log.Errorf("reload: %s", err)
+			continue
+		}
+		res, err := reloader.Reload(cfg)
+		if err != nil {
+			log.Errorf("reload: %s", err)
+			continue
+		}
+		for _, n := range res.AddedServeNodes {
+			if err := pkg.AddServeNode(n); err != nil {
+				log.Errorf("reload: start serve node %s: %s", n, err)
+				continue
+			}
+			log.Infof("reload: added serve node %s", n)
+		}
+		for _, n := range res.RemovedServeNodes {
+			if err := pkg.RemoveServeNode(n); err != nil {
+				log.Errorf("reload: stop serve node %s: %s", n, err)
+				continue
+			}
+			log.Infof("reload: removed serve node %s", n)
+		}
+		if res.ChainNodeChanged {
+			log.Infof("reload: chain node changed %q -> %q", res.OldChainNode, res.NewChainNode)
+		}
+	}
+}
+
+// multicastNodeID returns a random identifier this node advertises itself
+// under, so it can tell its own beacons apart from peers'.
+func multicastNodeID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// serveNodeSchemes extracts the URI scheme (e.g. "socks5", "http") out of
+// each ServeNode entry, for advertising what protocols this node serves.
+func serveNodeSchemes(serveNodes []string) []string {
+	out := make([]string, 0, len(serveNodes))
+	for _, n := range serveNodes {
+		if u, err := url.Parse(n); err == nil && u.Scheme != "" {
+			out = append(out, u.Scheme)
+		}
+	}
+	return out
+}
+
+// confirmMulticastPeerHandler builds the admin handler for
+// "confirmMulticastPeer": an operator-driven opt-in that promotes a peer
+// mc has discovered over LAN multicast to the chain's node. This is
+// deliberately not automatic - see Multicast.Confirm.
+func confirmMulticastPeerHandler(mc *core.Multicast) core.AdminHandlerFunc {
+	return func(params json.RawMessage) (interface{}, error) {
+		var p struct {
+			NodeID string `json:"nodeId"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+		if err := mc.Confirm(p.NodeID); err != nil {
+			return nil, err
+		}
+		return map[string]string{"nodeId": p.NodeID}, nil
+	}
+}
+
 var ServerCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "serve",
@@ -24,9 +150,77 @@ var ServerCmd = &cobra.Command{
 		util.InitLogger(util.Debug)
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := pkg.Start(nodeConfig); err != nil {
+		// A config file is read at startup too, not just on SIGHUP: without
+		// this, `serve --config foo.yaml` with no -L/-F flags would come up
+		// with zero serve nodes until an operator happened to send one.
+		// Flags still win over the file where both are given.
+		if configFile != "" {
+			cfg, err := loadConfigFile(configFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(nodeConfig.ServeNodes) == 0 {
+				nodeConfig.ServeNodes = cfg.ServeNodes
+			}
+			if nodeConfig.ChainNode == "" {
+				nodeConfig.ChainNode = cfg.ChainNode
+			}
+		}
+
+		// pkg.Start builds and returns the *core.Chain it actually dials
+		// through, so the admin socket and hot reload below observe and
+		// mutate the same chain serving real traffic instead of one built
+		// on the side.
+		chain, err := pkg.Start(nodeConfig)
+		if err != nil {
 			log.Fatal(err)
 		}
+
+		var admin *core.Admin
+		if adminSocket != "" {
+			admin = core.NewAdmin("unix", adminSocket, chain)
+			go func() {
+				if err := admin.ListenAndServe(); err != nil {
+					log.Errorf("admin socket stopped: %s", err)
+				}
+			}()
+		}
+
+		if configFile != "" {
+			reloader := core.NewReloader(chain, core.Config{ServeNodes: nodeConfig.ServeNodes, ChainNode: nodeConfig.ChainNode})
+			go watchConfigReload(reloader)
+		}
+
+		if multicastAddr != "" {
+			var mcOpts []core.MulticastOption
+			if multicastIfaceAllow != "" || multicastIfaceDeny != "" {
+				var allow, deny *regexp.Regexp
+				if multicastIfaceAllow != "" {
+					if allow, err = regexp.Compile(multicastIfaceAllow); err != nil {
+						log.Fatalf("invalid --multicast-iface-allow: %s", err)
+					}
+				}
+				if multicastIfaceDeny != "" {
+					if deny, err = regexp.Compile(multicastIfaceDeny); err != nil {
+						log.Fatalf("invalid --multicast-iface-deny: %s", err)
+					}
+				}
+				mcOpts = append(mcOpts, core.InterfaceFilterMulticastOption(allow, deny))
+			}
+			if len(multicastTrustPeers) > 0 {
+				mcOpts = append(mcOpts, core.TrustedPeersMulticastOption(multicastTrustPeers...))
+			}
+			mc := core.NewMulticast(multicastNodeID(), multicastAddr, serveNodeSchemes(nodeConfig.ServeNodes), chain, mcOpts...)
+			if admin != nil {
+				admin.Handle("confirmMulticastPeer", confirmMulticastPeerHandler(mc))
+			}
+			go func() {
+				if err := mc.Run(context.Background()); err != nil {
+					log.Errorf("multicast: %s", err)
+				}
+			}()
+		}
+
 		select {}
 	},
-}
\ No newline at end of file
+}
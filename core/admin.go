@@ -0,0 +1,408 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+// AdminHandlerFunc handles a single admin request and returns a response
+// payload, or an error if the request could not be satisfied.
+type AdminHandlerFunc func(params json.RawMessage) (interface{}, error)
+
+// Admin is a JSON-RPC control socket that exposes runtime state and
+// mutation endpoints for a running kubevpn node, similar in spirit to
+// yggdrasil's admin API. It is safe for concurrent requests.
+type Admin struct {
+	network string
+	address string
+	chain   *Chain
+	stack   IPStack
+
+	mu       sync.RWMutex
+	handlers map[string]AdminHandlerFunc
+
+	routesMu sync.RWMutex
+	routes   map[string]bool // CIDR -> present
+
+	listener net.Listener
+}
+
+// NewAdmin creates an admin socket bound to network/address, e.g.
+// ("unix", "/var/run/kubevpn/admin.sock") or ("tcp", "127.0.0.1:9699").
+// chain may be nil, in which case chain-backed endpoints report empty state.
+func NewAdmin(network, address string, chain *Chain) *Admin {
+	a := &Admin{
+		network:  network,
+		address:  address,
+		chain:    chain,
+		handlers: make(map[string]AdminHandlerFunc),
+		routes:   make(map[string]bool),
+	}
+	a.registerDefaults()
+	return a
+}
+
+// Handle registers a handler for the named admin request, overriding any
+// existing handler for that name. Callers add requests the built-in set
+// doesn't cover here (e.g. cmd's confirmMulticastPeer). Handlers such as
+// autoHandler don't call Handle: they record their connections with
+// registerSession, which the built-in getSessions enumerates.
+func (a *Admin) Handle(request string, fn AdminHandlerFunc) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.handlers[request] = fn
+}
+
+// SetIPStack attaches the IPStack addRoute/removeRoute install routes on.
+// Callers that build their own Admin with a stack already in hand should
+// use this; addRoute/removeRoute also fall back to whatever stack most
+// recently self-registered via RegisterIPStack (see openTun/openGvisorTun)
+// when this hasn't been called, so the control socket still works even
+// when it's wired up before the stack exists.
+func (a *Admin) SetIPStack(stack IPStack) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stack = stack
+}
+
+// ListenAndServe starts accepting admin connections. It blocks until the
+// listener is closed or Accept returns an error.
+func (a *Admin) ListenAndServe() error {
+	if a.network == "unix" {
+		_ = os.Remove(a.address)
+	}
+	ln, err := net.Listen(a.network, a.address)
+	if err != nil {
+		return fmt.Errorf("admin: listen %s/%s: %w", a.network, a.address, err)
+	}
+	a.listener = ln
+	log.Logf("[admin] listening on %s/%s", a.network, a.address)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go a.serveConn(conn)
+	}
+}
+
+// Close shuts down the admin listener.
+func (a *Admin) Close() error {
+	if a.listener == nil {
+		return nil
+	}
+	return a.listener.Close()
+}
+
+type adminRequest struct {
+	Request string          `json:"request"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type adminResponse struct {
+	Status   string      `json:"status"`
+	Request  string      `json:"request"`
+	Response interface{} `json:"response,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// serveConn reads newline-delimited JSON requests off conn and writes back
+// one JSON response per request until the connection is closed.
+func (a *Admin) serveConn(conn net.Conn) {
+	defer conn.Close()
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	enc := json.NewEncoder(conn)
+	for {
+		var req adminRequest
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		resp := adminResponse{Request: req.Request}
+		a.mu.RLock()
+		fn, ok := a.handlers[req.Request]
+		a.mu.RUnlock()
+		switch {
+		case !ok:
+			resp.Status = "error"
+			resp.Error = fmt.Sprintf("unknown request %q", req.Request)
+		default:
+			out, err := fn(req.Params)
+			if err != nil {
+				resp.Status = "error"
+				resp.Error = err.Error()
+			} else {
+				resp.Status = "success"
+				resp.Response = out
+			}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// registerDefaults wires up every built-in admin request. There's no
+// setLogLevel here: the rest of core logs through github.com/go-log/log,
+// which (unlike the logrus this file used to pull in just for that one
+// handler) has no level concept to adjust - adding one back would mean
+// plumbing a level check through every Logf call in the package, not
+// just this file.
+func (a *Admin) registerDefaults() {
+	a.Handle("getSelf", a.getSelf)
+	a.Handle("getPeers", a.getPeers)
+	a.Handle("getRoutes", a.getRoutes)
+	a.Handle("getSessions", a.getSessions)
+	a.Handle("getTUN", a.getTUN)
+	a.Handle("addPeer", a.addPeer)
+	a.Handle("removePeer", a.removePeer)
+	a.Handle("addRoute", a.addRoute)
+	a.Handle("removeRoute", a.removeRoute)
+}
+
+type selfInfo struct {
+	BuildName string `json:"buildName"`
+	Retries   int    `json:"retries"`
+	Attempts  int64  `json:"attempts"`
+	Failures  int64  `json:"failures"`
+}
+
+func (a *Admin) getSelf(json.RawMessage) (interface{}, error) {
+	info := selfInfo{BuildName: "kubevpn"}
+	if a.chain != nil {
+		info.Retries = a.chain.Retries
+		info.Attempts = a.chain.Attempts()
+		info.Failures = a.chain.Failures()
+	}
+	return info, nil
+}
+
+type peerInfo struct {
+	Addr string `json:"addr"`
+}
+
+func (a *Admin) getPeers(json.RawMessage) (interface{}, error) {
+	if a.chain == nil || a.chain.IsEmpty() {
+		return []peerInfo{}, nil
+	}
+	return []peerInfo{{Addr: a.chain.Node().Addr}}, nil
+}
+
+// routeInfo describes one CIDR directed into the tunnel. This is distinct
+// from peerInfo: a peer identifies the chain's single upstream node, while
+// a route identifies a subnet an operator wants carried over it.
+type routeInfo struct {
+	CIDR string `json:"cidr"`
+}
+
+func (a *Admin) getRoutes(json.RawMessage) (interface{}, error) {
+	a.routesMu.RLock()
+	defer a.routesMu.RUnlock()
+	out := make([]routeInfo, 0, len(a.routes))
+	for cidr := range a.routes {
+		out = append(out, routeInfo{CIDR: cidr})
+	}
+	return out, nil
+}
+
+func (a *Admin) getSessions(json.RawMessage) (interface{}, error) {
+	return Sessions(), nil
+}
+
+func (a *Admin) getTUN(json.RawMessage) (interface{}, error) {
+	if tunInfoProvider == nil {
+		return nil, errors.New("tun device not registered")
+	}
+	return tunInfoProvider()
+}
+
+type peerParams struct {
+	Addr string `json:"addr"`
+}
+
+func (a *Admin) addPeer(params json.RawMessage) (interface{}, error) {
+	if a.chain == nil {
+		return nil, errors.New("admin: no chain attached")
+	}
+	var p peerParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+	if nodeFactory == nil {
+		return nil, errors.New("admin: node factory not configured")
+	}
+	node, err := nodeFactory(p.Addr)
+	if err != nil {
+		return nil, err
+	}
+	a.chain.SwapNode(node)
+	return peerInfo{Addr: node.Addr}, nil
+}
+
+func (a *Admin) removePeer(json.RawMessage) (interface{}, error) {
+	if a.chain == nil {
+		return nil, errors.New("admin: no chain attached")
+	}
+	a.chain.SwapNode(nil)
+	return nil, nil
+}
+
+type routeParams struct {
+	CIDR string `json:"cidr"`
+}
+
+// addRoute installs a CIDR an operator wants carried over the tunnel on
+// the active IPStack (see SetIPStack), then records it so getRoutes
+// reports it. It errors rather than silently updating only the registry
+// if no IPStack is attached, since a route that's recorded but never
+// installed would make getRoutes report intent that was never applied.
+func (a *Admin) addRoute(params json.RawMessage) (interface{}, error) {
+	var p routeParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+	_, subnet, err := net.ParseCIDR(p.CIDR)
+	if err != nil {
+		return nil, fmt.Errorf("admin: invalid route %q: %w", p.CIDR, err)
+	}
+	stack := a.ipStack()
+	if stack == nil {
+		return nil, errors.New("admin: no IP stack attached, route not installed")
+	}
+	if err := stack.addSubnet(context.Background(), subnet); err != nil {
+		return nil, fmt.Errorf("admin: install route %q: %w", p.CIDR, err)
+	}
+	a.routesMu.Lock()
+	a.routes[p.CIDR] = true
+	a.routesMu.Unlock()
+	return routeInfo{CIDR: p.CIDR}, nil
+}
+
+func (a *Admin) removeRoute(params json.RawMessage) (interface{}, error) {
+	var p routeParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+	_, subnet, err := net.ParseCIDR(p.CIDR)
+	if err != nil {
+		return nil, fmt.Errorf("admin: invalid route %q: %w", p.CIDR, err)
+	}
+	stack := a.ipStack()
+	if stack == nil {
+		return nil, errors.New("admin: no IP stack attached, route not removed")
+	}
+	if err := stack.removeSubnet(context.Background(), subnet); err != nil {
+		return nil, fmt.Errorf("admin: remove route %q: %w", p.CIDR, err)
+	}
+	a.routesMu.Lock()
+	delete(a.routes, p.CIDR)
+	a.routesMu.Unlock()
+	return nil, nil
+}
+
+// ipStack returns the IPStack addRoute/removeRoute should install routes
+// on: the one explicitly attached via SetIPStack if there is one,
+// otherwise whatever most recently self-registered via RegisterIPStack.
+func (a *Admin) ipStack() IPStack {
+	a.mu.RLock()
+	stack := a.stack
+	a.mu.RUnlock()
+	if stack != nil {
+		return stack
+	}
+	return ipStackProvider
+}
+
+// ipStackProvider is the IPStack addRoute/removeRoute fall back to when
+// no Admin has had SetIPStack called on it directly. It is nil until a
+// Device or GvisorDevice registers itself via RegisterIPStack.
+var ipStackProvider IPStack
+
+// RegisterIPStack registers stack as the one admin's addRoute/removeRoute
+// endpoints install routes on, the IPStack analogue of RegisterTUNInfo.
+// openTun and openGvisorTun call this themselves so the control socket
+// works against whichever stack backend the node actually opened, without
+// the caller that constructs Admin needing its own reference to it.
+func RegisterIPStack(stack IPStack) {
+	ipStackProvider = stack
+}
+
+// nodeFactory builds a chain Node from a peer address string (e.g.
+// "tcp://host:port"). It is nil until the package that owns Node/URL
+// parsing registers one via SetNodeFactory.
+//
+// Unlike IPStack and TUN info, there is no Device/GvisorDevice-style
+// concrete type in this package that could self-register a nodeFactory:
+// building a Node means parsing a node URL into a scheme-specific Client,
+// and that construction code lives in the package that calls NewAdmin,
+// not in core. Until that
+// caller invokes SetNodeFactory, addPeer stays a real but unreachable
+// endpoint rather than a wired one.
+var nodeFactory func(addr string) (*Node, error)
+
+// SetNodeFactory registers the function used by admin's addPeer endpoint,
+// Reloader.Reload and Multicast.Confirm to construct a Node from a peer
+// address string.
+func SetNodeFactory(fn func(addr string) (*Node, error)) {
+	nodeFactory = fn
+}
+
+// tunInfoProvider reports the state of the active TUN/TAP device for
+// getTUN. It is nil until a Device registers one via RegisterTUNInfo.
+var tunInfoProvider func() (interface{}, error)
+
+// RegisterTUNInfo registers the function used by admin's getTUN endpoint to
+// report the state of the active TUN device.
+func RegisterTUNInfo(fn func() (interface{}, error)) {
+	tunInfoProvider = fn
+}
+
+// sessionSeq generates monotonically increasing session IDs.
+var sessionSeq uint64
+
+// SessionInfo describes one live connection held open by a Handler.
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	Protocol   string    `json:"protocol"`
+	LocalAddr  string    `json:"localAddr"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Opened     time.Time `json:"opened"`
+}
+
+var sessions sync.Map // id string -> *SessionInfo
+
+// registerSession records conn as a live session handled under protocol and
+// returns a function that must be called once the connection is done with,
+// to remove it from the registry.
+func registerSession(protocol string, conn net.Conn) func() {
+	id := fmt.Sprintf("%s-%d", protocol, atomic.AddUint64(&sessionSeq, 1))
+	info := &SessionInfo{
+		ID:         id,
+		Protocol:   protocol,
+		LocalAddr:  conn.LocalAddr().String(),
+		RemoteAddr: conn.RemoteAddr().String(),
+		Opened:     time.Now(),
+	}
+	sessions.Store(id, info)
+	return func() { sessions.Delete(id) }
+}
+
+// Sessions returns a snapshot of all currently open sessions registered by
+// Handlers such as autoHandler.
+func Sessions() []SessionInfo {
+	var out []SessionInfo
+	sessions.Range(func(_, v interface{}) bool {
+		out = append(out, *v.(*SessionInfo))
+		return true
+	})
+	return out
+}
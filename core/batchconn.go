@@ -0,0 +1,120 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+const (
+	// batchSegmentSize and batchMaxSegments mirror wireguard-go's conn
+	// package defaults for coalescing writes with UDP_SEGMENT (GSO) and
+	// reads with UDP_GRO.
+	batchSegmentSize = 1452 // MTU-aligned UDP payload size
+	batchMaxSegments = 65
+	batchBufferSize  = batchMaxSegments * batchSegmentSize // 94,380 bytes
+
+	// batchGROBufferSize is the scratch buffer size a single recvmmsg slot
+	// needs when UDP_GRO is enabled: the kernel can coalesce up to a full
+	// maximum-size UDP datagram's worth of segments into one receive, so a
+	// slot sized to batchSegmentSize alone would silently truncate it.
+	batchGROBufferSize = 65535
+)
+
+// BatchConn is implemented by UDP connections able to read or write
+// several datagrams per syscall (recvmmsg/sendmmsg), optionally coalesced
+// via GSO (UDP_SEGMENT) on transmit and GRO (UDP_GRO) on receive.
+// Chain.dial returns one of these for udp*/ networks; on platforms or
+// remotes that don't support batching it transparently falls back to
+// per-packet sends.
+type BatchConn interface {
+	net.PacketConn
+	// WritePackets sends bufs to addr, coalescing each run of consecutive
+	// equal-length packets into one GSO datagram when addr is known to
+	// support UDP_SEGMENT, or as individual datagrams otherwise. addr may be nil if the underlying socket is
+	// already connected (e.g. via net.DialUDP), in which case bufs go to
+	// that fixed peer.
+	WritePackets(bufs [][]byte, addr net.Addr) error
+	// ReadPackets reads one or more (possibly GRO-coalesced) datagrams
+	// into bufs, returning how many were filled along with each one's
+	// length in sizes and its source in addrs.
+	ReadPackets(bufs [][]byte, sizes []int, addrs []net.Addr) (n int, err error)
+}
+
+// gsoCache remembers, per remote address, whether the last GSO write
+// succeeded. Remotes that return EIO on a segmented write fall back to
+// per-packet writes from then on instead of re-discovering the failure on
+// every send.
+type gsoCache struct {
+	mu        sync.RWMutex
+	supported map[string]bool
+}
+
+func newGSOCache() *gsoCache {
+	return &gsoCache{supported: make(map[string]bool)}
+}
+
+// supports reports whether addr is believed to accept GSO writes. Unknown
+// addresses are assumed to support it until proven otherwise.
+func (g *gsoCache) supports(addr string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	ok, known := g.supported[addr]
+	return !known || ok
+}
+
+func (g *gsoCache) disable(addr string) {
+	g.mu.Lock()
+	g.supported[addr] = false
+	g.mu.Unlock()
+}
+
+// batchUDPConn is the portable fallback BatchConn: it has no access to
+// recvmmsg/sendmmsg, so WritePackets/ReadPackets just loop over the plain
+// socket one datagram at a time. Platforms with a real batch syscall path
+// (see batchconn_linux.go) provide their own implementation instead.
+type batchUDPConn struct {
+	*net.UDPConn
+	gso *gsoCache
+}
+
+// newBatchUDPConn wraps conn with batching support where the platform
+// allows it. The result always satisfies net.Conn; callers that want the
+// batch methods can type-assert it to BatchConn.
+func newBatchUDPConn(conn *net.UDPConn) net.Conn {
+	return newPlatformBatchUDPConn(conn)
+}
+
+func (c *batchUDPConn) WritePackets(bufs [][]byte, addr net.Addr) error {
+	if addr == nil {
+		for _, b := range bufs {
+			if _, err := c.UDPConn.Write(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	ua, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return fmt.Errorf("batchconn: addr must be *net.UDPAddr, got %T", addr)
+	}
+	for _, b := range bufs {
+		if _, err := c.UDPConn.WriteToUDP(b, ua); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *batchUDPConn) ReadPackets(bufs [][]byte, sizes []int, addrs []net.Addr) (int, error) {
+	if len(bufs) == 0 {
+		return 0, nil
+	}
+	n, addr, err := c.UDPConn.ReadFromUDP(bufs[0])
+	if err != nil {
+		return 0, err
+	}
+	sizes[0] = n
+	addrs[0] = addr
+	return 1, nil
+}
@@ -0,0 +1,252 @@
+//go:build linux
+
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"unsafe"
+
+	"github.com/go-log/log"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/sys/unix"
+)
+
+// linuxBatchUDPConn is the Linux BatchConn: it batches writes with
+// sendmmsg and coalesces them with UDP_SEGMENT (GSO), and batches reads
+// with recvmmsg, relying on UDP_GRO to have already coalesced incoming
+// datagrams kernel-side. Both paths go through golang.org/x/net/ipv4's
+// Batch API, which is backed by sendmmsg/recvmmsg on Linux, the same
+// approach wireguard-go's conn package uses.
+//
+// Only IPv4 sockets get the batch path for now; IPv6 falls back to the
+// portable per-packet implementation (it needs the parallel
+// golang.org/x/net/ipv6 Batch API, which isn't wired up here yet).
+type linuxBatchUDPConn struct {
+	*net.UDPConn
+	pc  *ipv4.PacketConn
+	gso *gsoCache
+
+	// readRaw/readOOB/readMsgs are the recvmmsg scratch buffers for
+	// ReadPackets, sized for GRO's worst case (a full coalesced datagram
+	// per slot) and kept across calls instead of reallocated on every read
+	// - ReadPackets is driven by a single owning read loop (see
+	// core/pump.go's pumpConnToStack), so there's no concurrent access to
+	// guard against.
+	readRaw  [][]byte
+	readOOB  [][]byte
+	readMsgs []ipv4.Message
+}
+
+func newPlatformBatchUDPConn(conn *net.UDPConn) net.Conn {
+	c := &linuxBatchUDPConn{UDPConn: conn, gso: newGSOCache()}
+	if la, ok := conn.LocalAddr().(*net.UDPAddr); ok && la.IP.To4() != nil {
+		pc := ipv4.NewPacketConn(conn)
+		if rc, err := conn.SyscallConn(); err == nil {
+			_ = rc.Control(func(fd uintptr) {
+				_ = unix.SetsockoptInt(int(fd), unix.IPPROTO_UDP, unix.UDP_GRO, 1)
+			})
+		}
+		c.pc = pc
+	}
+	return c
+}
+
+func (c *linuxBatchUDPConn) WritePackets(bufs [][]byte, addr net.Addr) error {
+	var ua *net.UDPAddr
+	if addr != nil {
+		var ok bool
+		if ua, ok = addr.(*net.UDPAddr); !ok {
+			return fmt.Errorf("batchconn: addr must be *net.UDPAddr, got %T", addr)
+		}
+	}
+	gsoKey := c.gsoKey(ua)
+	if c.pc == nil || len(bufs) < 2 || !c.gso.supports(gsoKey) {
+		return c.writeSequential(bufs, ua)
+	}
+
+	msgs := make([]ipv4.Message, 0, len(bufs))
+	for _, group := range groupByLength(bufs) {
+		if len(group) < 2 {
+			msgs = append(msgs, ipv4.Message{Buffers: [][]byte{group[0]}, Addr: ua})
+			continue
+		}
+		segSize := len(group[0])
+		payload := make([]byte, 0, len(group)*segSize)
+		for _, b := range group {
+			payload = append(payload, b...)
+		}
+		msgs = append(msgs, ipv4.Message{
+			Buffers: [][]byte{payload},
+			Addr:    ua,
+			OOB:     gsoControlMessage(segSize),
+		})
+	}
+	for len(msgs) > 0 {
+		n, err := c.pc.WriteBatch(msgs, 0)
+		if err != nil {
+			c.gso.disable(gsoKey)
+			return c.writeSequential(bufs, ua)
+		}
+		msgs = msgs[n:]
+	}
+	return nil
+}
+
+// gsoKey is the string the gsoCache keys a peer's GSO support on: ua's
+// address if given, or the socket's already-connected remote address when
+// ua is nil (a nil addr means "use the connected peer", see WritePackets).
+func (c *linuxBatchUDPConn) gsoKey(ua *net.UDPAddr) string {
+	if ua != nil {
+		return ua.String()
+	}
+	if ra := c.UDPConn.RemoteAddr(); ra != nil {
+		return ra.String()
+	}
+	return ""
+}
+
+// writeSequential writes bufs one datagram at a time, to ua if given or
+// to the socket's connected peer if ua is nil.
+func (c *linuxBatchUDPConn) writeSequential(bufs [][]byte, ua *net.UDPAddr) error {
+	for _, b := range bufs {
+		var err error
+		if ua != nil {
+			_, err = c.UDPConn.WriteToUDP(b, ua)
+		} else {
+			_, err = c.UDPConn.Write(b)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *linuxBatchUDPConn) ReadPackets(bufs [][]byte, sizes []int, addrs []net.Addr) (int, error) {
+	if c.pc == nil || len(bufs) < 2 {
+		n, addr, err := c.UDPConn.ReadFromUDP(firstOrEmpty(bufs))
+		if err != nil {
+			return 0, err
+		}
+		sizes[0] = n
+		addrs[0] = addr
+		return 1, nil
+	}
+
+	// Each slot gets its own batchGROBufferSize scratch buffer rather than
+	// reading directly into bufs[i]: UDP_GRO can coalesce several original
+	// datagrams into one receive, and that coalesced read has to be split
+	// back into its original segments (below) before it's copied out to the
+	// caller's bufs, one entry per original packet. These scratch buffers
+	// are cached on c and reused across calls instead of allocated fresh
+	// each time - this is the hot UDP receive path.
+	if len(c.readMsgs) != len(bufs) {
+		c.readRaw = make([][]byte, len(bufs))
+		c.readOOB = make([][]byte, len(bufs))
+		c.readMsgs = make([]ipv4.Message, len(bufs))
+		for i := range c.readMsgs {
+			c.readRaw[i] = make([]byte, batchGROBufferSize)
+			c.readOOB[i] = make([]byte, unix.CmsgSpace(2))
+		}
+	}
+	raw, msgs := c.readRaw, c.readMsgs
+	for i := range msgs {
+		msgs[i].Buffers = [][]byte{raw[i]}
+		msgs[i].OOB = c.readOOB[i]
+	}
+	n, err := c.pc.ReadBatch(msgs, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	out := 0
+	for i := 0; i < n; i++ {
+		data := raw[i][:msgs[i].N]
+		segSize := groSegmentSize(msgs[i].OOB[:msgs[i].NN])
+		for _, seg := range splitGROSegments(data, segSize) {
+			if out >= len(bufs) {
+				log.Logf("[batchconn] GRO read: dropping segment(s), only %d output slots available", len(bufs))
+				return out, nil
+			}
+			sizes[out] = copy(bufs[out], seg)
+			addrs[out] = msgs[i].Addr
+			out++
+		}
+	}
+	return out, nil
+}
+
+// groSegmentSize extracts the UDP_GRO segment size the kernel attaches to
+// a coalesced receive's control message, or 0 if oob carries none (meaning
+// the datagram wasn't coalesced and should be treated as a single packet).
+func groSegmentSize(oob []byte) int {
+	if len(oob) < unix.CmsgLen(2) {
+		return 0
+	}
+	hdr := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	if hdr.Level != unix.IPPROTO_UDP || hdr.Type != unix.UDP_GRO {
+		return 0
+	}
+	return int(binary.NativeEndian.Uint16(oob[unix.CmsgLen(0):]))
+}
+
+// splitGROSegments splits a (possibly GRO-coalesced) receive back into its
+// original datagrams: segSize-byte chunks, with the last one short if data
+// isn't an exact multiple. A segSize of 0 (no GRO control message) or one
+// that's not actually smaller than data means it wasn't coalesced.
+func splitGROSegments(data []byte, segSize int) [][]byte {
+	if segSize <= 0 || segSize >= len(data) {
+		return [][]byte{data}
+	}
+	var out [][]byte
+	for len(data) > 0 {
+		n := segSize
+		if n > len(data) {
+			n = len(data)
+		}
+		out = append(out, data[:n])
+		data = data[n:]
+	}
+	return out
+}
+
+func firstOrEmpty(bufs [][]byte) []byte {
+	if len(bufs) == 0 {
+		return nil
+	}
+	return bufs[0]
+}
+
+// groupByLength partitions bufs into runs of consecutive, equal-length
+// packets, preserving order. UDP_SEGMENT splits a coalesced datagram into
+// fixed-size segments, so only packets that already share a length can be
+// coalesced into one GSO write without padding (and corrupting) the
+// shorter ones; a run of one is just sent as an ordinary single datagram.
+func groupByLength(bufs [][]byte) [][][]byte {
+	var groups [][][]byte
+	for _, b := range bufs {
+		if n := len(groups); n > 0 {
+			last := groups[n-1]
+			if len(last[0]) == len(b) {
+				groups[n-1] = append(last, b)
+				continue
+			}
+		}
+		groups = append(groups, [][]byte{b})
+	}
+	return groups
+}
+
+// gsoControlMessage builds the cmsg that tells the kernel to split a
+// coalesced datagram into segSize-byte segments (UDP_SEGMENT/GSO).
+func gsoControlMessage(segSize int) []byte {
+	oob := make([]byte, unix.CmsgSpace(2))
+	hdr := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	hdr.Level = unix.IPPROTO_UDP
+	hdr.Type = unix.UDP_SEGMENT
+	hdr.SetLen(unix.CmsgLen(2))
+	binary.NativeEndian.PutUint16(oob[unix.CmsgLen(0):], uint16(segSize))
+	return oob
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package core
+
+import "net"
+
+// newPlatformBatchUDPConn on non-Linux platforms has no recvmmsg/sendmmsg
+// or UDP_SEGMENT/UDP_GRO equivalent available through the Go standard
+// library, so it returns the portable per-packet fallback.
+func newPlatformBatchUDPConn(conn *net.UDPConn) net.Conn {
+	return &batchUDPConn{UDPConn: conn, gso: newGSOCache()}
+}
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"github.com/wencaiwulue/kubevpn/util"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -17,7 +20,19 @@ var (
 type Chain struct {
 	isRoute bool
 	Retries int
-	node    *Node
+
+	// FailTimeout is how long a node is skipped after it fails a public-key
+	// pin check (see ParsePin/Pin.Verify). Defaults to 30s if zero.
+	FailTimeout time.Duration
+
+	mu   sync.RWMutex
+	node *Node
+
+	attempts int64
+	failures int64
+
+	failMu      sync.Mutex
+	failedUntil time.Time
 }
 
 // NewChain creates a proxy chain with a list of proxy nodes.
@@ -35,17 +50,95 @@ func newRoute() *Chain {
 }
 
 func (c *Chain) Node() *Node {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.node
 }
 
 func (c *Chain) SetNode(node *Node) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.node = node
+}
+
+// SwapNode atomically replaces the chain's node with node and returns the
+// previous one (nil if the chain was empty). In-flight DialContext calls
+// that already selected a route keep using the node they captured; only
+// dials started after SwapNode returns observe the new node. The new node
+// gets a clean fail-timeout window rather than inheriting whatever
+// remained of the old node's, since a pin failure against the old node
+// says nothing about the new one.
+func (c *Chain) SwapNode(node *Node) *Node {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := c.node
 	c.node = node
+
+	// Clear the fail window under the same c.mu critical section the swap
+	// happens in, so a dial that fails the old node's pin check and calls
+	// markFailed can't race in between the swap and the reset and have its
+	// (stale) failure wiped out of order relative to what it observed.
+	c.failMu.Lock()
+	c.failedUntil = time.Time{}
+	c.failMu.Unlock()
+
+	return old
 }
 
 // IsEmpty checks if the chain is empty.
 // An empty chain means that there is no proxy node or node group in the chain.
 func (c *Chain) IsEmpty() bool {
-	return c == nil || c.node == nil
+	return c == nil || c.Node() == nil
+}
+
+// Attempts returns the number of dial attempts made through this chain.
+func (c *Chain) Attempts() int64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&c.attempts)
+}
+
+// Failures returns the number of failed dial attempts made through this
+// chain.
+func (c *Chain) Failures() int64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&c.failures)
+}
+
+// markFailed marks node as failed for FailTimeout (30s by default), so
+// subsequent dials fail fast instead of retrying a node that just failed
+// its public-key pin check. It does nothing if SwapNode has already
+// replaced node, so a late failure is not charged to its successor.
+func (c *Chain) markFailed(node *Node) {
+	if c == nil {
+		return
+	}
+	timeout := c.FailTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.node != node {
+		return
+	}
+	c.failMu.Lock()
+	c.failedUntil = time.Now().Add(timeout)
+	c.failMu.Unlock()
+}
+
+// isFailed reports whether the chain's current node is still within its
+// FailTimeout window.
+func (c *Chain) isFailed() bool {
+	if c == nil {
+		return false
+	}
+	c.failMu.Lock()
+	defer c.failMu.Unlock()
+	return time.Now().Before(c.failedUntil)
 }
 
 // DialContext connects to the address on the named network using the provided context.
@@ -56,15 +149,25 @@ func (c *Chain) DialContext(ctx context.Context, network, address string) (conn
 	}
 
 	for i := 0; i < retries; i++ {
+		if c != nil {
+			atomic.AddInt64(&c.attempts, 1)
+		}
 		conn, err = c.dial(ctx, network, address)
 		if err == nil {
 			break
 		}
+		if c != nil {
+			atomic.AddInt64(&c.failures, 1)
+		}
 	}
 	return
 }
 
 func (c *Chain) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if c.isFailed() {
+		return nil, fmt.Errorf("chain: node failed its pin check, retrying later")
+	}
+
 	route, err := c.selectRouteFor(address)
 	if err != nil {
 		return nil, err
@@ -79,9 +182,21 @@ func (c *Chain) dial(ctx context.Context, network, address string) (net.Conn, er
 		switch network {
 		case "udp", "udp4", "udp6":
 			if address == "" {
-				return net.ListenUDP(network, nil)
+				pc, err := net.ListenUDP(network, nil)
+				if err != nil {
+					return nil, err
+				}
+				return newBatchUDPConn(pc), nil
+			}
+			raddr, err := net.ResolveUDPAddr(network, ipAddr)
+			if err != nil {
+				return nil, err
+			}
+			uc, err := net.DialUDP(network, nil, raddr)
+			if err != nil {
+				return nil, err
 			}
-		default:
+			return newBatchUDPConn(uc), nil
 		}
 		d := &net.Dialer{
 			Timeout: util.DialTimeout,
@@ -100,6 +215,17 @@ func (c *Chain) dial(ctx context.Context, network, address string) (net.Conn, er
 		conn.Close()
 		return nil, err
 	}
+
+	pin, err := ParsePin(route.Node().Addr)
+	if err != nil {
+		cc.Close()
+		return nil, err
+	}
+	if err := pin.Verify(cc); err != nil {
+		cc.Close()
+		c.markFailed(route.Node())
+		return nil, err
+	}
 	return cc, nil
 }
 
@@ -165,6 +291,6 @@ func (c *Chain) selectRouteFor(addr string) (route *Chain, err error) {
 	}
 
 	route = newRoute()
-	route.SetNode(c.node)
+	route.SetNode(c.Node())
 	return
 }
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"golang.zx2c4.com/wireguard/tun"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+// GvisorDevice is a userspace IP stack backed by gVisor's netstack (via
+// wireguard-go's netstack.CreateNetTUN), selected with --stack=gvisor. It
+// terminates TCP/UDP entirely inside this process, dispatching connections
+// to Chain via DialContext, so it needs no /dev/net/tun and no elevated
+// privileges - useful in containers without TUN support, CI runners, and
+// restricted macOS setups where the native Device (see device_windows.go
+// and its Unix equivalents) can't be opened.
+type GvisorDevice struct {
+	tun.Device
+	tnet *netstack.Net
+	dns  net.IP
+	mtu  int
+}
+
+var _ IPStack = (*GvisorDevice)(nil)
+var _ BatchIPStack = (*GvisorDevice)(nil)
+
+// openGvisorTun creates a GvisorDevice owning addrs, with dnsServers
+// available for resolution inside the stack. Unlike openTun, it never
+// touches the kernel's network stack.
+func openGvisorTun(addrs, dnsServers []netip.Addr, mtu int) (*GvisorDevice, error) {
+	dev, tnet, err := netstack.CreateNetTUN(addrs, dnsServers, mtu)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gVisor TUN device: %w", err)
+	}
+	d := &GvisorDevice{Device: dev, tnet: tnet, mtu: mtu}
+
+	// Self-register with the admin package so getTUN/addRoute/removeRoute
+	// work against whatever stack a node actually opened, without the
+	// caller that builds the *Admin needing its own reference to d.
+	RegisterTUNInfo(func() (interface{}, error) {
+		return map[string]interface{}{"stack": "gvisor", "addrs": addrs, "mtu": mtu}, nil
+	})
+	RegisterIPStack(d)
+
+	return d, nil
+}
+
+func (d *GvisorDevice) addSubnet(_ context.Context, _ *net.IPNet) error {
+	return fmt.Errorf("gvisor stack: addSubnet not supported, addresses are fixed at creation")
+}
+
+func (d *GvisorDevice) removeSubnet(_ context.Context, _ *net.IPNet) error {
+	return fmt.Errorf("gvisor stack: removeSubnet not supported, addresses are fixed at creation")
+}
+
+func (d *GvisorDevice) setDNS(_ context.Context, server net.IP, _ []string) error {
+	d.dns = server
+	return nil
+}
+
+func (d *GvisorDevice) setMTU(mtu int) error {
+	return fmt.Errorf("gvisor stack: MTU is fixed at creation (%d)", d.mtu)
+}
+
+func (d *GvisorDevice) readPacket(into []byte) (int, error) {
+	return d.Device.Read(into, 0)
+}
+
+func (d *GvisorDevice) writePacket(from []byte) (int, error) {
+	return d.Device.Write(from, 0)
+}
+
+// readPackets fills only bufs[0], with a single tun.Device.Read;
+// wireguard-go's netstack TUN has no native batch read, so this is the
+// portable adapter RelayBatch needs to treat GvisorDevice as a
+// BatchIPStack.
+func (d *GvisorDevice) readPackets(bufs [][]byte, sizes []int) (int, error) {
+	n, err := d.readPacket(bufs[0])
+	if err != nil {
+		return 0, err
+	}
+	sizes[0] = n
+	return 1, nil
+}
+
+// writePackets writes each of bufs with its own tun.Device.Write call.
+func (d *GvisorDevice) writePackets(bufs [][]byte) error {
+	for _, b := range bufs {
+		if _, err := d.writePacket(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DialContext dials address from inside the gVisor stack's own network
+// namespace. This is how connections initiated by processes on the
+// userspace side of the stack reach Chain.dial.
+func (d *GvisorDevice) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d.tnet.DialContext(ctx, network, address)
+}
+
+// Serve is the other half of "terminate TCP here, dispatch via
+// DialContext": for each of addrs, it listens inside the gVisor stack and,
+// for every connection accepted, dials the same address through chain and
+// relays between the two. addrs are the destinations this stack should
+// intercept and forward - typically the in-cluster subnets routed into the
+// TUN, taken from the same IPRoutes a kernel-backed Device would be given.
+// It returns once every listener is up; each one then serves until d is
+// closed.
+func (d *GvisorDevice) Serve(chain *Chain, addrs []netip.AddrPort) error {
+	for _, addr := range addrs {
+		ln, err := d.tnet.ListenTCPAddrPort(addr)
+		if err != nil {
+			return fmt.Errorf("gvisor stack: listen %s: %w", addr, err)
+		}
+		go d.acceptLoop(ln, chain)
+	}
+	return nil
+}
+
+func (d *GvisorDevice) acceptLoop(ln net.Listener, chain *Chain) {
+	defer ln.Close()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go d.forward(conn, chain)
+	}
+}
+
+// forward dials conn's original destination (its LocalAddr, since ln was
+// bound to that exact address inside the stack) through chain and relays
+// between the two, the same pattern core/http.go's httpHandler uses for a
+// terminated connection.
+func (d *GvisorDevice) forward(conn net.Conn, chain *Chain) {
+	defer conn.Close()
+	cc, err := chain.DialContext(context.Background(), "tcp", conn.LocalAddr().String())
+	if err != nil {
+		return
+	}
+	defer cc.Close()
+	relay(conn, cc)
+}
@@ -20,6 +20,9 @@ type Device struct {
 	interfaceIndex uint32
 }
 
+var _ IPStack = (*Device)(nil)
+var _ BatchIPStack = (*Device)(nil)
+
 func openTun(ctx context.Context) (td *Device, err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -43,6 +46,14 @@ func openTun(ctx context.Context) (td *Device, err error) {
 	}
 	td.interfaceIndex = iface.InterfaceIndex
 
+	// Self-register with the admin package so getTUN/addRoute/removeRoute
+	// work against this device without the caller that builds the *Admin
+	// needing its own reference to td.
+	RegisterTUNInfo(func() (interface{}, error) {
+		return map[string]interface{}{"stack": "system", "name": td.name, "interfaceIndex": td.interfaceIndex}, nil
+	})
+	RegisterIPStack(td)
+
 	return td, nil
 }
 
@@ -120,3 +131,26 @@ func (t *Device) readPacket(into []byte) (int, error) {
 func (t *Device) writePacket(from []byte) (int, error) {
 	return t.Device.Write(from, 0)
 }
+
+// readPackets fills bufs[0] with a single tun.Device.Read; the
+// wireguard-go NativeTun backing this Device has no batch read on
+// Windows, so this is the portable adapter RelayBatch needs to treat
+// Device as a BatchIPStack.
+func (t *Device) readPackets(bufs [][]byte, sizes []int) (int, error) {
+	n, err := t.readPacket(bufs[0])
+	if err != nil {
+		return 0, err
+	}
+	sizes[0] = n
+	return 1, nil
+}
+
+// writePackets writes each of bufs with its own tun.Device.Write call.
+func (t *Device) writePackets(bufs [][]byte) error {
+	for _, b := range bufs {
+		if _, err := t.writePacket(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
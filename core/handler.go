@@ -175,25 +175,120 @@ func (h *autoHandler) Init(options ...HandlerOption) {
 	}
 }
 
+// autoPeekSize is the largest the sniff peek is ever grown to, to tell
+// protocols apart; it must cover the longest fixed prefix we match on
+// (the 8-byte "OPTIONS " and "CONNECT " request lines).
+const autoPeekSize = 16
+
 func (h *autoHandler) Handle(conn net.Conn) {
 	br := bufio.NewReader(conn)
-	b, err := br.Peek(1)
-	if err != nil {
-		log.Logf("[auto] %s - %s: %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+
+	// Peek grows one byte at a time instead of asking for autoPeekSize up
+	// front: a SOCKS5 client only sends its 3-byte greeting (VER,
+	// NMETHODS, METHOD) and then blocks waiting for our method-selection
+	// reply, so Peek(16) would block forever waiting for bytes that
+	// client will never send until it hears back from us. Growing stops
+	// as soon as the buffered prefix either identifies a protocol or
+	// rules all of them out.
+	var b []byte
+	var err error
+	var proto string
+	var handler Handler
+	for n := 1; n <= autoPeekSize; n++ {
+		b, err = br.Peek(n)
+		if proto, handler = h.sniff(b); handler != nil {
+			break
+		}
+		if err != nil || !maybeSniffable(b) {
+			break
+		}
+	}
+	if handler == nil {
+		if err != nil && len(b) == 0 {
+			log.Logf("[auto] %s - %s: %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+			conn.Close()
+			return
+		}
+		log.Logf("[auto] %s - %s: unrecognized protocol, probeResist=%q", conn.RemoteAddr(), conn.LocalAddr(), h.options.ProbeResist)
 		conn.Close()
 		return
 	}
 
 	cc := &bufferdConn{Conn: conn, br: br}
-	var handler Handler
-	switch b[0] {
-	case gosocks5.Ver5: // socks5
-		handler = &socks5Handler{options: h.options}
-	}
 	handler.Init()
+
+	unregister := registerSession(proto, cc)
+	defer unregister()
 	handler.Handle(cc)
 }
 
+// sniff inspects the leading bytes peeked off a connection and picks the
+// Handler responsible for that protocol, so a single listener can
+// multiplex SOCKS5, HTTP(S), SNI-routed TLS, and SSH traffic.
+//
+// WireGuard is deliberately not one of these: its handshake is a UDP
+// datagram, never a byte stream accepted by this TCP listener, so there is
+// no prefix here that could ever identify one in practice.
+func (h *autoHandler) sniff(b []byte) (string, Handler) {
+	if len(b) == 0 {
+		return "", nil
+	}
+	switch {
+	case b[0] == gosocks5.Ver5:
+		return "socks5", &socks5Handler{options: h.options}
+	case isHTTPMethod(b):
+		return "http", &httpHandler{options: h.options}
+	case len(b) >= 3 && b[0] == 0x16 && b[1] == 0x03:
+		return "tls", &tlsHandler{options: h.options}
+	case len(b) >= 7 && string(b[:7]) == "SSH-2.0":
+		return "ssh", &sshHandler{options: h.options}
+	default:
+		return "", nil
+	}
+}
+
+// httpMethods are the request lines isHTTPMethod recognizes, each
+// including its trailing space so "POST" doesn't also match "POSTGRES" or
+// similar.
+var httpMethods = []string{"GET ", "HEAD ", "POST ", "PUT ", "DELETE ", "OPTIONS ", "PATCH ", "TRACE ", "CONNECT "}
+
+func isHTTPMethod(b []byte) bool {
+	for _, m := range httpMethods {
+		if len(b) >= len(m) && string(b[:len(m)]) == m {
+			return true
+		}
+	}
+	return false
+}
+
+// maybeSniffable reports whether b is still a plausible prefix of one of
+// sniff's protocols, i.e. whether growing the peek further could still
+// turn up a match. Once none of them could, Handle stops growing instead
+// of blocking on bytes a client that already gave up hope of a match
+// would never send.
+func maybeSniffable(b []byte) bool {
+	if len(b) == 0 {
+		return true
+	}
+	if b[0] == gosocks5.Ver5 || (b[0] == 0x16 && (len(b) < 2 || b[1] == 0x03)) {
+		return true
+	}
+	for _, m := range httpMethods {
+		n := len(b)
+		if n > len(m) {
+			n = len(m)
+		}
+		if string(b[:n]) == m[:n] {
+			return true
+		}
+	}
+	const banner = "SSH-2.0"
+	if n := len(b); n <= len(banner) && string(b) == banner[:n] {
+		return true
+	}
+	return false
+}
+
 type bufferdConn struct {
 	net.Conn
 	br *bufio.Reader
@@ -201,4 +296,4 @@ type bufferdConn struct {
 
 func (c *bufferdConn) Read(b []byte) (int, error) {
 	return c.br.Read(b)
-}
\ No newline at end of file
+}
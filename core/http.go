@@ -0,0 +1,97 @@
+package core
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-log/log"
+)
+
+// httpHandler serves plain HTTP requests sniffed by autoHandler, proxying
+// each one through options.Chain the same way socks5Handler does. CONNECT
+// requests are delegated to httpConnectHandler.
+type httpHandler struct {
+	options *HandlerOptions
+}
+
+func (h *httpHandler) Init(options ...HandlerOption) {
+	if h.options == nil {
+		h.options = &HandlerOptions{}
+	}
+	for _, opt := range options {
+		opt(h.options)
+	}
+}
+
+func (h *httpHandler) Handle(conn net.Conn) {
+	defer conn.Close()
+
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil {
+		log.Logf("[http] %s - %s: %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+		return
+	}
+
+	if req.Method == http.MethodConnect {
+		(&httpConnectHandler{options: h.options}).handle(conn, req)
+		return
+	}
+	h.forward(conn, req)
+}
+
+func (h *httpHandler) forward(conn net.Conn, req *http.Request) {
+	target := req.Host
+	if !strings.Contains(target, ":") {
+		target += ":80"
+	}
+
+	cc, err := h.options.Chain.DialContext(req.Context(), "tcp", target)
+	if err != nil {
+		log.Logf("[http] %s -> %s: %s", conn.RemoteAddr(), target, err)
+		return
+	}
+	defer cc.Close()
+
+	if err := req.Write(cc); err != nil {
+		log.Logf("[http] %s -> %s: %s", conn.RemoteAddr(), target, err)
+		return
+	}
+	relay(conn, cc)
+}
+
+// httpConnectHandler tunnels the raw bytes of an HTTP CONNECT request
+// after replying 200 Connection Established, like a classic HTTP proxy.
+type httpConnectHandler struct {
+	options *HandlerOptions
+}
+
+func (h *httpConnectHandler) handle(conn net.Conn, req *http.Request) {
+	cc, err := h.options.Chain.DialContext(req.Context(), "tcp", req.Host)
+	if err != nil {
+		log.Logf("[http-connect] %s -> %s: %s", conn.RemoteAddr(), req.Host, err)
+		_, _ = conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+		return
+	}
+	defer cc.Close()
+
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return
+	}
+	relay(conn, cc)
+}
+
+// relay copies data in both directions between a and b and returns only
+// once both directions are done: after the a<-b copy in the caller's
+// goroutine ends, it still waits for the b<-a copy to end too.
+func relay(a, b net.Conn) {
+	errc := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(b, a)
+		errc <- err
+	}()
+	_, _ = io.Copy(a, b)
+	<-errc
+}
@@ -0,0 +1,29 @@
+package core
+
+import (
+	"context"
+	"net"
+)
+
+// IPStack is the common interface satisfied by every TUN backend: the
+// native kernel TUN device (see Device in device_windows.go and its Unix
+// equivalents) and the gVisor-backed userspace netstack (see
+// GvisorDevice). It lets the rest of core stay agnostic to which stack is
+// terminating a given session's packets.
+type IPStack interface {
+	addSubnet(ctx context.Context, subnet *net.IPNet) error
+	removeSubnet(ctx context.Context, subnet *net.IPNet) error
+	setDNS(ctx context.Context, server net.IP, domains []string) error
+	setMTU(mtu int) error
+	readPacket(into []byte) (int, error)
+	writePacket(from []byte) (int, error)
+	Close() error
+}
+
+// BatchIPStack is implemented by IPStack backends that can read or write
+// several TUN packets per syscall, the TUN-side analogue of BatchConn.
+type BatchIPStack interface {
+	IPStack
+	readPackets(bufs [][]byte, sizes []int) (n int, err error)
+	writePackets(bufs [][]byte) error
+}
@@ -0,0 +1,283 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	multicastGroup = "ff02::114"
+	multicastPort  = 9001
+)
+
+// MulticastOption configures a Multicast discovery instance.
+type MulticastOption func(m *Multicast)
+
+// InterfaceFilterMulticastOption restricts beaconing/listening to
+// interfaces whose name matches allow and does not match deny. Either
+// regex may be nil to skip that check.
+func InterfaceFilterMulticastOption(allow, deny *regexp.Regexp) MulticastOption {
+	return func(m *Multicast) {
+		m.allow = allow
+		m.deny = deny
+	}
+}
+
+// BeaconIntervalMulticastOption sets how often this node announces itself.
+func BeaconIntervalMulticastOption(d time.Duration) MulticastOption {
+	return func(m *Multicast) { m.beaconInterval = d }
+}
+
+// PeerTimeoutMulticastOption sets how long a discovered peer can go unseen
+// before being aged out.
+func PeerTimeoutMulticastOption(d time.Duration) MulticastOption {
+	return func(m *Multicast) { m.peerTimeout = d }
+}
+
+// TrustedPeersMulticastOption pre-authorizes nodeIDs to be confirmed onto
+// the chain the moment they're first discovered, instead of waiting for an
+// operator to drive Confirm by hand. It's the same explicit per-nodeID
+// opt-in Confirm already requires (see its doc comment) - this just lets
+// an operator give that opt-in up front, which matters because Confirm is
+// otherwise only reachable through an admin-socket handler, and a
+// deployment may run --multicast-advertise with no admin socket at all.
+func TrustedPeersMulticastOption(nodeIDs ...string) MulticastOption {
+	return func(m *Multicast) {
+		for _, id := range nodeIDs {
+			m.trusted[id] = true
+		}
+	}
+}
+
+// beacon is the payload multicast over the LAN to advertise a node.
+type beacon struct {
+	NodeID    string   `json:"nodeId"`
+	Addr      string   `json:"addr"`
+	Protocols []string `json:"protocols"`
+}
+
+type multicastPeer struct {
+	beacon
+	lastSeen time.Time
+}
+
+// Multicast discovers kubevpn peers on the local network via link-local
+// IPv6 multicast (analogous to yggdrasil's multicast peering). Discovery
+// alone does not change chain: a peer becomes chain's node only through
+// Confirm, or at once when its node ID was pre-trusted with
+// TrustedPeersMulticastOption.
+type Multicast struct {
+	nodeID    string
+	addr      string
+	protocols []string
+	chain     *Chain
+
+	allow *regexp.Regexp
+	deny  *regexp.Regexp
+
+	beaconInterval time.Duration
+	peerTimeout    time.Duration
+	trusted        map[string]bool
+
+	mu    sync.Mutex
+	peers map[string]*multicastPeer
+}
+
+// NewMulticast creates a Multicast discovery instance that advertises addr
+// (this node's own listener address) and puts confirmed or pre-trusted
+// peers on chain.
+func NewMulticast(nodeID, addr string, protocols []string, chain *Chain, opts ...MulticastOption) *Multicast {
+	m := &Multicast{
+		nodeID:         nodeID,
+		addr:           addr,
+		protocols:      protocols,
+		chain:          chain,
+		beaconInterval: 5 * time.Second,
+		peerTimeout:    30 * time.Second,
+		trusted:        make(map[string]bool),
+		peers:          make(map[string]*multicastPeer),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Run beacons this node and listens for peers until ctx is done.
+func (m *Multicast) Run(ctx context.Context) error {
+	ifaces, err := m.interfaces()
+	if err != nil {
+		return fmt.Errorf("multicast: %w", err)
+	}
+	if len(ifaces) == 0 {
+		return fmt.Errorf("multicast: no usable multicast interfaces")
+	}
+
+	group := &net.UDPAddr{IP: net.ParseIP(multicastGroup), Port: multicastPort}
+	conn, err := net.ListenMulticastUDP("udp6", &ifaces[0], group)
+	if err != nil {
+		return fmt.Errorf("multicast: listen: %w", err)
+	}
+	defer conn.Close()
+
+	go m.listen(ctx, conn)
+	go m.reap(ctx)
+	m.beaconLoop(ctx, group, ifaces)
+	return nil
+}
+
+// interfaces returns the multicast-capable interfaces allowed by the
+// configured allow/deny filters.
+func (m *Multicast) interfaces() ([]net.Interface, error) {
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var out []net.Interface
+	for _, iface := range all {
+		if iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		if m.allow != nil && !m.allow.MatchString(iface.Name) {
+			continue
+		}
+		if m.deny != nil && m.deny.MatchString(iface.Name) {
+			continue
+		}
+		out = append(out, iface)
+	}
+	return out, nil
+}
+
+func (m *Multicast) beaconLoop(ctx context.Context, group *net.UDPAddr, ifaces []net.Interface) {
+	conn, err := net.ListenUDP("udp6", &net.UDPAddr{Port: 0})
+	if err != nil {
+		log.Logf("[multicast] beacon socket: %s", err)
+		return
+	}
+	defer conn.Close()
+	pc := ipv6.NewPacketConn(conn)
+
+	payload, _ := json.Marshal(beacon{NodeID: m.nodeID, Addr: m.addr, Protocols: m.protocols})
+
+	ticker := time.NewTicker(m.beaconInterval)
+	defer ticker.Stop()
+	for {
+		for i := range ifaces {
+			if err := pc.SetMulticastInterface(&ifaces[i]); err != nil {
+				continue
+			}
+			if _, err := pc.WriteTo(payload, nil, group); err != nil {
+				log.Logf("[multicast] beacon on %s: %s", ifaces[i].Name, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Multicast) listen(ctx context.Context, conn *net.UDPConn) {
+	buf := make([]byte, 1500)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		var b beacon
+		if err := json.Unmarshal(buf[:n], &b); err != nil || b.NodeID == "" || b.NodeID == m.nodeID {
+			continue
+		}
+		m.addPeer(b, src)
+	}
+}
+
+func (m *Multicast) addPeer(b beacon, src *net.UDPAddr) {
+	m.mu.Lock()
+	_, known := m.peers[b.NodeID]
+	m.peers[b.NodeID] = &multicastPeer{beacon: b, lastSeen: time.Now()}
+	trusted := m.trusted[b.NodeID]
+	m.mu.Unlock()
+
+	if known {
+		return
+	}
+	log.Logf("[multicast] discovered peer %s at %s via %s; call Confirm to add it to the chain", b.NodeID, b.Addr, src)
+	if trusted {
+		if err := m.Confirm(b.NodeID); err != nil {
+			log.Logf("[multicast] auto-confirm trusted peer %s: %s", b.NodeID, err)
+		}
+	}
+}
+
+// Confirm promotes a discovered peer to the chain's node, replacing
+// whatever node is configured there. addPeer calls it on its own only for
+// a nodeID pre-trusted with TrustedPeersMulticastOption; any other peer
+// waits for an explicit call: a LAN beacon is unauthenticated, so
+// silently swapping it into the chain would let any device on the
+// network hijack the proxy chain of every listening instance. Callers
+// (e.g. an admin-socket endpoint an operator invokes explicitly) opt in
+// to a specific nodeID after reviewing Peers.
+func (m *Multicast) Confirm(nodeID string) error {
+	m.mu.Lock()
+	p, ok := m.peers[nodeID]
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("multicast: unknown peer %q", nodeID)
+	}
+	if m.chain == nil || nodeFactory == nil {
+		return fmt.Errorf("multicast: no chain or node factory configured")
+	}
+	node, err := nodeFactory(p.Addr)
+	if err != nil {
+		return fmt.Errorf("multicast: build node for peer %q: %w", nodeID, err)
+	}
+	log.Logf("[multicast] confirming peer %s at %s", nodeID, p.Addr)
+	m.chain.SwapNode(node)
+	return nil
+}
+
+func (m *Multicast) reap(ctx context.Context) {
+	ticker := time.NewTicker(m.peerTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			for id, p := range m.peers {
+				if time.Since(p.lastSeen) > m.peerTimeout {
+					delete(m.peers, id)
+					log.Logf("[multicast] peer %s aged out", id)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// Peers returns the node IDs of currently known multicast peers.
+func (m *Multicast) Peers() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]string, 0, len(m.peers))
+	for id := range m.peers {
+		out = append(out, id)
+	}
+	return out
+}
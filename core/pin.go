@@ -0,0 +1,102 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/go-log/log"
+)
+
+// Pin is a certificate-fingerprint pin extracted from a node URI's query
+// string, e.g. tls://host:port?sha256=<fingerprint>. It closes an MITM gap
+// when chaining through untrusted networks.
+//
+// An ed25519 handshake-key variant (tcp://host:port?ed25519=<hex>) was
+// considered, but the node's Client (e.g. a Noise/WireGuard transport)
+// doesn't expose its handshake key on the plain net.Conn Verify sees, so
+// there's no way to check it here. Rather than parse a pin that can never
+// be enforced, that query parameter is simply not recognized - add it back
+// once a Client exposes a handshake key to verify against.
+type Pin struct {
+	Algorithm string // "sha256"
+	Value     []byte
+}
+
+// ParsePin extracts a Pin from a node address, if present. It returns
+// (nil, nil) if addr carries no recognized pin query parameter.
+func ParsePin(addr string) (*Pin, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("pin: parse node address %q: %w", addr, err)
+	}
+	if u.Query().Get("ed25519") != "" {
+		log.Logf("pin: %q carries an ed25519= pin, which this Client does not enforce and is being ignored - dials to it proceed with no pin verification", addr)
+	}
+	hexVal := u.Query().Get("sha256")
+	if hexVal == "" {
+		return nil, nil
+	}
+	val, err := hex.DecodeString(hexVal)
+	if err != nil {
+		return nil, fmt.Errorf("pin: decode sha256 value: %w", err)
+	}
+	return &Pin{Algorithm: "sha256", Value: val}, nil
+}
+
+// Verify checks conn against the pin, returning an error if it does not
+// match. A nil Pin always verifies.
+func (p *Pin) Verify(conn net.Conn) error {
+	if p == nil {
+		return nil
+	}
+	switch p.Algorithm {
+	case "sha256":
+		tc, ok := unwrapTLSConn(conn)
+		if !ok {
+			return fmt.Errorf("pin: sha256 pinning requires a TLS connection")
+		}
+		// ConnectionState is a zero value - no PeerCertificates - until the
+		// handshake has run, and Chain.dial calls Verify right after
+		// ConnectContext with no intervening I/O to trigger it lazily.
+		// Handshake is a no-op once the handshake already completed.
+		if err := tc.Handshake(); err != nil {
+			return fmt.Errorf("pin: tls handshake: %w", err)
+		}
+		certs := tc.ConnectionState().PeerCertificates
+		if len(certs) == 0 {
+			return fmt.Errorf("pin: no peer certificate presented")
+		}
+		sum := sha256.Sum256(certs[0].Raw)
+		if !bytes.Equal(sum[:], p.Value) {
+			return fmt.Errorf("pin: certificate fingerprint mismatch")
+		}
+		return nil
+	default:
+		return fmt.Errorf("pin: unknown pin algorithm %q", p.Algorithm)
+	}
+}
+
+// unwrapTLSConn finds the *tls.Conn underlying conn, following an
+// Unwrap() net.Conn chain if conn isn't one directly. A Client's
+// ConnectContext isn't guaranteed to hand Verify the raw *tls.Conn it
+// dialed - it may wrap it (e.g. for buffering, framing) - and without
+// unwrapping, every pinned node behind such a wrapper would fail
+// Verify, get markFailed, and be skipped for 30s on a permanent loop.
+func unwrapTLSConn(conn net.Conn) (*tls.Conn, bool) {
+	for conn != nil {
+		if tc, ok := conn.(*tls.Conn); ok {
+			return tc, true
+		}
+		u, ok := conn.(interface{ Unwrap() net.Conn })
+		if !ok {
+			return nil, false
+		}
+		conn = u.Unwrap()
+	}
+	return nil, false
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestParsePin(t *testing.T) {
+	t.Run("no pin", func(t *testing.T) {
+		p, err := ParsePin("tcp://host:8080")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if p != nil {
+			t.Fatalf("expected nil pin, got %+v", p)
+		}
+	})
+
+	t.Run("sha256 pin", func(t *testing.T) {
+		p, err := ParsePin("tls://host:8080?sha256=aabbcc")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if p == nil || p.Algorithm != "sha256" {
+			t.Fatalf("expected sha256 pin, got %+v", p)
+		}
+		want, _ := hex.DecodeString("aabbcc")
+		if string(p.Value) != string(want) {
+			t.Fatalf("value = %x, want %x", p.Value, want)
+		}
+	})
+
+	t.Run("ed25519 query param is not recognized", func(t *testing.T) {
+		p, err := ParsePin("tcp://host:8080?ed25519=deadbeef")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if p != nil {
+			t.Fatalf("expected nil pin, got %+v", p)
+		}
+	})
+
+	t.Run("invalid hex", func(t *testing.T) {
+		if _, err := ParsePin("tcp://host:8080?sha256=zz"); err == nil {
+			t.Fatal("expected error for invalid hex value")
+		}
+	})
+
+	t.Run("invalid address", func(t *testing.T) {
+		if _, err := ParsePin("://bad"); err == nil {
+			t.Fatal("expected error for unparsable address")
+		}
+	})
+}
+
+func TestPinVerifyUnknownAlgorithmFailsClosed(t *testing.T) {
+	p := &Pin{Algorithm: "ed25519", Value: []byte{1, 2, 3}}
+	if err := p.Verify(nil); err == nil {
+		t.Fatal("expected Verify to fail closed for an unrecognized algorithm, got nil error")
+	}
+}
+
+func TestPinVerifyNilPin(t *testing.T) {
+	var p *Pin
+	if err := p.Verify(nil); err != nil {
+		t.Fatalf("nil pin should always verify, got %s", err)
+	}
+}
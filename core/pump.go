@@ -0,0 +1,92 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// RelayBatch pumps packets between stack and conn, using their batch
+// readPackets/writePackets and
+// ReadPackets/WritePackets methods so a single syscall can move several
+// packets at once. It is the actual consumer of BatchIPStack/BatchConn;
+// RunBatchRelay below is the entry point that dials a Chain and hands the
+// resulting BatchConn to it.
+//
+// It returns when the stack->conn direction stops, with that direction's
+// error; an error in the conn->stack direction ends only that direction.
+func RelayBatch(stack BatchIPStack, conn BatchConn) error {
+	errc := make(chan error, 1)
+	go func() { errc <- pumpConnToStack(conn, stack) }()
+	err := pumpStackToConn(stack, conn)
+	if err == nil {
+		err = <-errc
+	}
+	return err
+}
+
+func pumpStackToConn(stack BatchIPStack, conn BatchConn) error {
+	bufs := make([][]byte, batchMaxSegments)
+	sizes := make([]int, batchMaxSegments)
+	for i := range bufs {
+		bufs[i] = make([]byte, batchSegmentSize)
+	}
+	for {
+		n, err := stack.readPackets(bufs, sizes)
+		if err != nil {
+			return err
+		}
+		packets := make([][]byte, n)
+		for i := 0; i < n; i++ {
+			packets[i] = bufs[i][:sizes[i]]
+		}
+		if err := conn.WritePackets(packets, nil); err != nil {
+			return fmt.Errorf("pump: write %d packets: %w", len(packets), err)
+		}
+	}
+}
+
+// RunBatchRelay dials network/address through c and relays packets
+// between stack and the dialed connection with RelayBatch. This is the
+// TUN<->chain forwarding loop that owns a stack and a Chain is expected to
+// call once per session (the udp branch of Chain.dial returns a
+// newBatchUDPConn, which satisfies BatchConn) instead of looping over the
+// single-packet readPacket/writePacket and Read/Write methods.
+//
+// It returns an error if the dial doesn't yield a BatchConn, since there
+// is no batch path to fall back from at that point - callers that need a
+// non-batching fallback should dial and pump manually instead.
+func RunBatchRelay(ctx context.Context, stack BatchIPStack, c *Chain, network, address string) error {
+	conn, err := c.DialContext(ctx, network, address)
+	if err != nil {
+		return fmt.Errorf("pump: dial %s %s: %w", network, address, err)
+	}
+	defer conn.Close()
+	bc, ok := conn.(BatchConn)
+	if !ok {
+		return fmt.Errorf("pump: dialed connection %T does not support packet batching", conn)
+	}
+	return RelayBatch(stack, bc)
+}
+
+func pumpConnToStack(conn BatchConn, stack BatchIPStack) error {
+	bufs := make([][]byte, batchMaxSegments)
+	sizes := make([]int, batchMaxSegments)
+	addrs := make([]net.Addr, batchMaxSegments)
+	for i := range bufs {
+		bufs[i] = make([]byte, batchSegmentSize)
+	}
+	for {
+		n, err := conn.ReadPackets(bufs, sizes, addrs)
+		if err != nil {
+			return err
+		}
+		packets := make([][]byte, n)
+		for i := 0; i < n; i++ {
+			packets[i] = bufs[i][:sizes[i]]
+		}
+		if err := stack.writePackets(packets); err != nil {
+			return fmt.Errorf("pump: write %d packets to stack: %w", len(packets), err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeStack is a minimal BatchIPStack that serves a fixed set of packets
+// once and then reports an error, so RelayBatch's pump loop terminates.
+type fakeStack struct {
+	out     [][]byte
+	served  bool
+	written [][]byte
+}
+
+func (f *fakeStack) addSubnet(context.Context, *net.IPNet) error    { return nil }
+func (f *fakeStack) removeSubnet(context.Context, *net.IPNet) error { return nil }
+func (f *fakeStack) setDNS(context.Context, net.IP, []string) error { return nil }
+func (f *fakeStack) setMTU(int) error                               { return nil }
+func (f *fakeStack) Close() error                                   { return nil }
+
+func (f *fakeStack) readPacket(into []byte) (int, error) {
+	n, _, err := f.readN(into, 1)
+	return n, err
+}
+
+func (f *fakeStack) writePacket(from []byte) (int, error) {
+	f.written = append(f.written, append([]byte(nil), from...))
+	return len(from), nil
+}
+
+func (f *fakeStack) readN(into []byte, _ int) (int, bool, error) {
+	if f.served || len(f.out) == 0 {
+		return 0, false, errors.New("fakeStack: no more packets")
+	}
+	n := copy(into, f.out[0])
+	f.out = f.out[1:]
+	if len(f.out) == 0 {
+		f.served = true
+	}
+	return n, true, nil
+}
+
+func (f *fakeStack) readPackets(bufs [][]byte, sizes []int) (int, error) {
+	if f.served || len(f.out) == 0 {
+		return 0, errors.New("fakeStack: no more packets")
+	}
+	n := 0
+	for n < len(bufs) && len(f.out) > 0 {
+		sizes[n] = copy(bufs[n], f.out[0])
+		f.out = f.out[1:]
+		n++
+	}
+	if len(f.out) == 0 {
+		f.served = true
+	}
+	return n, nil
+}
+
+func (f *fakeStack) writePackets(bufs [][]byte) error {
+	for _, b := range bufs {
+		f.written = append(f.written, append([]byte(nil), b...))
+	}
+	return nil
+}
+
+// fakeBatchConn is a minimal BatchConn with no incoming packets of its
+// own, so RelayBatch's conn->stack direction errors out immediately and
+// only the stack->conn direction is exercised.
+type fakeBatchConn struct {
+	net.PacketConn
+	written [][]byte
+}
+
+func (c *fakeBatchConn) WritePackets(bufs [][]byte, _ net.Addr) error {
+	for _, b := range bufs {
+		c.written = append(c.written, append([]byte(nil), b...))
+	}
+	return nil
+}
+
+func (c *fakeBatchConn) ReadPackets([][]byte, []int, []net.Addr) (int, error) {
+	return 0, errors.New("fakeBatchConn: no packets")
+}
+
+func (c *fakeBatchConn) Close() error                       { return nil }
+func (c *fakeBatchConn) LocalAddr() net.Addr                { return nil }
+func (c *fakeBatchConn) SetDeadline(time.Time) error        { return nil }
+func (c *fakeBatchConn) SetReadDeadline(time.Time) error    { return nil }
+func (c *fakeBatchConn) SetWriteDeadline(time.Time) error   { return nil }
+func (c *fakeBatchConn) ReadFrom([]byte) (int, net.Addr, error) {
+	return 0, nil, errors.New("fakeBatchConn: no packets")
+}
+func (c *fakeBatchConn) WriteTo([]byte, net.Addr) (int, error) { return 0, nil }
+
+func TestRelayBatchMovesStackPacketsToConn(t *testing.T) {
+	stack := &fakeStack{out: [][]byte{[]byte("one"), []byte("two")}}
+	conn := &fakeBatchConn{}
+
+	err := RelayBatch(stack, conn)
+	if err == nil {
+		t.Fatal("expected RelayBatch to return once both directions are exhausted")
+	}
+
+	want := [][]byte{[]byte("one"), []byte("two")}
+	if !reflect.DeepEqual(conn.written, want) {
+		t.Fatalf("conn.written = %v, want %v", conn.written, want)
+	}
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Config is the subset of node/chain configuration that can be hot
+// reloaded: the set of listeners to serve (-L) and the chain's next hop
+// (-F).
+type Config struct {
+	ServeNodes []string
+	ChainNode  string
+}
+
+// ReloadResult describes what changed between two Reloads.
+type ReloadResult struct {
+	AddedServeNodes   []string
+	RemovedServeNodes []string
+	ChainNodeChanged  bool
+	OldChainNode      string
+	NewChainNode      string
+}
+
+// Reloader tracks the Config a server was last started or reloaded with and
+// computes the minimal set of changes needed to move to a new Config,
+// applying chain-affecting changes to the attached Chain.
+type Reloader struct {
+	chain *Chain
+
+	mu      sync.Mutex
+	current Config
+}
+
+// NewReloader creates a Reloader seeded with the Config a server started
+// with, applying its changes to chain.
+func NewReloader(chain *Chain, initial Config) *Reloader {
+	return &Reloader{chain: chain, current: initial}
+}
+
+// Reload diffs next against the Config last passed to NewReloader/Reload.
+// Added and removed ServeNodes are reported for the caller to start and
+// drain respectively. If ChainNode changed, the Chain's node is atomically
+// swapped via SwapNode so in-flight DialContext calls finish on the old
+// node while new dials see the new one.
+func (r *Reloader) Reload(next Config) (ReloadResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res ReloadResult
+	res.AddedServeNodes, res.RemovedServeNodes = diffServeNodes(r.current.ServeNodes, next.ServeNodes)
+
+	if next.ChainNode != r.current.ChainNode {
+		res.ChainNodeChanged = true
+		res.OldChainNode = r.current.ChainNode
+		res.NewChainNode = next.ChainNode
+
+		if next.ChainNode == "" {
+			r.chain.SwapNode(nil)
+		} else {
+			if nodeFactory == nil {
+				return res, fmt.Errorf("reload: node factory not configured")
+			}
+			node, err := nodeFactory(next.ChainNode)
+			if err != nil {
+				return res, fmt.Errorf("reload: parse chain node %q: %w", next.ChainNode, err)
+			}
+			r.chain.SwapNode(node)
+		}
+	}
+
+	r.current = next
+	return res, nil
+}
+
+func diffServeNodes(old, next []string) (added, removed []string) {
+	oldSet := make(map[string]bool, len(old))
+	for _, n := range old {
+		oldSet[n] = true
+	}
+	nextSet := make(map[string]bool, len(next))
+	for _, n := range next {
+		nextSet[n] = true
+	}
+	for _, n := range next {
+		if !oldSet[n] {
+			added = append(added, n)
+		}
+	}
+	for _, n := range old {
+		if !nextSet[n] {
+			removed = append(removed, n)
+		}
+	}
+	return
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDiffServeNodes(t *testing.T) {
+	cases := []struct {
+		name        string
+		old, next   []string
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{
+			name: "no change",
+			old:  []string{"tcp://:1080"},
+			next: []string{"tcp://:1080"},
+		},
+		{
+			name:      "added only",
+			old:       []string{"tcp://:1080"},
+			next:      []string{"tcp://:1080", "tcp://:1081"},
+			wantAdded: []string{"tcp://:1081"},
+		},
+		{
+			name:        "removed only",
+			old:         []string{"tcp://:1080", "tcp://:1081"},
+			next:        []string{"tcp://:1080"},
+			wantRemoved: []string{"tcp://:1081"},
+		},
+		{
+			name:        "added and removed",
+			old:         []string{"tcp://:1080"},
+			next:        []string{"tcp://:1081"},
+			wantAdded:   []string{"tcp://:1081"},
+			wantRemoved: []string{"tcp://:1080"},
+		},
+		{
+			name: "empty to empty",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			added, removed := diffServeNodes(tc.old, tc.next)
+			sort.Strings(added)
+			sort.Strings(removed)
+			sort.Strings(tc.wantAdded)
+			sort.Strings(tc.wantRemoved)
+			if !reflect.DeepEqual(added, tc.wantAdded) {
+				t.Errorf("added = %v, want %v", added, tc.wantAdded)
+			}
+			if !reflect.DeepEqual(removed, tc.wantRemoved) {
+				t.Errorf("removed = %v, want %v", removed, tc.wantRemoved)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"context"
+	"net"
+
+	"github.com/go-log/log"
+)
+
+// sshHandler transparently relays a connection sniffed as an SSH client
+// by its protocol banner ("SSH-2.0-...") to the fixed destination
+// configured via HostHandlerOption.
+type sshHandler struct {
+	options *HandlerOptions
+}
+
+func (h *sshHandler) Init(options ...HandlerOption) {
+	if h.options == nil {
+		h.options = &HandlerOptions{}
+	}
+	for _, opt := range options {
+		opt(h.options)
+	}
+}
+
+func (h *sshHandler) Handle(conn net.Conn) {
+	defer conn.Close()
+
+	if h.options.Host == "" {
+		log.Logf("[ssh] %s: no destination host configured", conn.RemoteAddr())
+		return
+	}
+	target := h.options.Host
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, "22")
+	}
+
+	cc, err := h.options.Chain.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		log.Logf("[ssh] %s -> %s: %s", conn.RemoteAddr(), target, err)
+		return
+	}
+	defer cc.Close()
+	relay(conn, cc)
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/go-log/log"
+)
+
+// tlsHandler routes a sniffed TLS ClientHello by its SNI server name,
+// falling back to the fixed host configured via HostHandlerOption when
+// the client sent none.
+type tlsHandler struct {
+	options *HandlerOptions
+}
+
+func (h *tlsHandler) Init(options ...HandlerOption) {
+	if h.options == nil {
+		h.options = &HandlerOptions{}
+	}
+	for _, opt := range options {
+		opt(h.options)
+	}
+}
+
+func (h *tlsHandler) Handle(conn net.Conn) {
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+	sni, record, err := peekClientHello(br)
+	if err != nil {
+		log.Logf("[tls] %s - %s: %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+		return
+	}
+
+	target := sni
+	if target == "" {
+		target = h.options.Host
+	}
+	if target == "" {
+		log.Logf("[tls] %s: no SNI in ClientHello and no configured host to route to", conn.RemoteAddr())
+		return
+	}
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, "443")
+	}
+
+	cc, err := h.options.Chain.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		log.Logf("[tls] %s -> %s: %s", conn.RemoteAddr(), target, err)
+		return
+	}
+	defer cc.Close()
+
+	if _, err := cc.Write(record); err != nil {
+		return
+	}
+	relay(&bufferdConn{Conn: conn, br: br}, cc)
+}
+
+// peekClientHello reads a single TLS handshake record off br and extracts
+// the ClientHello's SNI server name, returning the raw record bytes too
+// so the caller can replay them unmodified to the real destination.
+func peekClientHello(br *bufio.Reader) (sni string, record []byte, err error) {
+	header, err := br.Peek(5)
+	if err != nil {
+		return "", nil, err
+	}
+	if header[0] != 0x16 {
+		return "", nil, fmt.Errorf("not a TLS handshake record")
+	}
+	length := int(binary.BigEndian.Uint16(header[3:5]))
+	record = make([]byte, 5+length)
+	if _, err := io.ReadFull(br, record); err != nil {
+		return "", nil, err
+	}
+	sni, err = parseSNI(record[5:])
+	return sni, record, err
+}
+
+// parseSNI walks a ClientHello body for the server_name (SNI) extension
+// per RFC 6066, ignoring everything it doesn't need. An empty result with
+// a nil error means the ClientHello simply carried no SNI extension.
+func parseSNI(body []byte) (string, error) {
+	if len(body) < 4 {
+		return "", fmt.Errorf("client hello too short")
+	}
+	body = body[4:] // handshake msg type(1) + length(3)
+
+	if len(body) < 2+32+1 {
+		return "", fmt.Errorf("client hello too short")
+	}
+	pos := 2 + 32 // client_version + random
+
+	sessionIDLen := int(body[pos])
+	pos++
+	pos += sessionIDLen
+	if pos+2 > len(body) {
+		return "", fmt.Errorf("client hello too short")
+	}
+
+	cipherSuitesLen := int(binary.BigEndian.Uint16(body[pos : pos+2]))
+	pos += 2 + cipherSuitesLen
+	if pos+1 > len(body) {
+		return "", fmt.Errorf("client hello too short")
+	}
+
+	compMethodsLen := int(body[pos])
+	pos++
+	pos += compMethodsLen
+	if pos+2 > len(body) {
+		return "", nil // no extensions
+	}
+
+	extsLen := int(binary.BigEndian.Uint16(body[pos : pos+2]))
+	pos += 2
+	end := pos + extsLen
+	if end > len(body) {
+		return "", fmt.Errorf("client hello extensions overrun")
+	}
+
+	for pos+4 <= end {
+		extType := binary.BigEndian.Uint16(body[pos : pos+2])
+		extLen := int(binary.BigEndian.Uint16(body[pos+2 : pos+4]))
+		pos += 4
+		if pos+extLen > end {
+			break
+		}
+		if extType == 0 { // server_name
+			data := body[pos : pos+extLen]
+			if len(data) >= 5 {
+				nameLen := int(binary.BigEndian.Uint16(data[3:5]))
+				if len(data) >= 5+nameLen {
+					return string(data[5 : 5+nameLen]), nil
+				}
+			}
+		}
+		pos += extLen
+	}
+	return "", nil
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// buildClientHello assembles a minimal TLS 1.2 ClientHello handshake
+// message in parseSNI's input form (a zeroed 4-byte msg type + length
+// header, which parseSNI skips, then the body), optionally carrying a
+// server_name extension for host.
+func buildClientHello(host string) []byte {
+	var body bytes.Buffer
+	body.Write([]byte{0x00, 0x00, 0x00, 0x00}) // msg type(1) + length(3), unused by parseSNI
+	body.Write(make([]byte, 2))                // client_version
+	body.Write(make([]byte, 32))               // random
+	body.WriteByte(0)                          // session id len
+	binary.Write(&body, binary.BigEndian, uint16(0)) // cipher suites len
+	body.WriteByte(0)                                // compression methods len
+
+	if host == "" {
+		binary.Write(&body, binary.BigEndian, uint16(0)) // extensions len
+		return body.Bytes()
+	}
+
+	var sni bytes.Buffer
+	binary.Write(&sni, binary.BigEndian, uint16(len(host)+3)) // server name list len
+	sni.WriteByte(0)                                          // name type: host_name
+	binary.Write(&sni, binary.BigEndian, uint16(len(host)))
+	sni.WriteString(host)
+
+	var ext bytes.Buffer
+	binary.Write(&ext, binary.BigEndian, uint16(0)) // extension type: server_name
+	binary.Write(&ext, binary.BigEndian, uint16(sni.Len()))
+	ext.Write(sni.Bytes())
+
+	binary.Write(&body, binary.BigEndian, uint16(ext.Len()))
+	body.Write(ext.Bytes())
+	return body.Bytes()
+}
+
+func TestParseSNI(t *testing.T) {
+	t.Run("with server name", func(t *testing.T) {
+		sni, err := parseSNI(buildClientHello("example.com"))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if sni != "example.com" {
+			t.Fatalf("sni = %q, want %q", sni, "example.com")
+		}
+	})
+
+	t.Run("no extensions", func(t *testing.T) {
+		sni, err := parseSNI(buildClientHello(""))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if sni != "" {
+			t.Fatalf("sni = %q, want empty", sni)
+		}
+	})
+
+	t.Run("too short", func(t *testing.T) {
+		if _, err := parseSNI([]byte{0x01, 0x02}); err == nil {
+			t.Fatal("expected error for truncated client hello")
+		}
+	})
+}